@@ -0,0 +1,265 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || linux || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd linux netbsd openbsd
+
+package nclient4
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/u-root/uio/uio"
+	xipv4 "golang.org/x/net/ipv4"
+)
+
+// maxFrameSize is large enough to hold the biggest Ethernet frame this
+// package ever builds or parses: Ethernet + max IPv4 header + UDP header +
+// the largest DHCPv4 message.
+const maxFrameSize = ethernetHeaderSize + ipv4MaximumHeaderSize + udpMinimumSize + dhcpv4.MaxMessageSize
+
+// framePool reuses the scratch buffers ReadBatch/WriteBatch build and parse
+// Ethernet+IP+UDP headers in, so a burst of packets (e.g. a PXE boot storm)
+// doesn't allocate one buffer per packet.
+//
+// It holds *[]byte rather than []byte: a bare slice header boxed into the
+// interface{} sync.Pool.Put takes would itself allocate on every Put,
+// defeating the point of pooling.
+var framePool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, maxFrameSize)
+		return &b
+	},
+}
+
+// frameBatcher is implemented by LinkConn backends that can send or receive
+// several frames in a single syscall (recvmmsg(2)/sendmmsg(2) on Linux, see
+// batch_linux.go). Backends that don't implement it fall back to one
+// ReadFrame/WriteFrame call per message.
+type frameBatcher interface {
+	ReadFrameBatch(bufs [][]byte) (int, error)
+	WriteFrameBatch(frames [][]byte) (int, error)
+}
+
+// ReadBatch reads up to len(ms) UDP packets bound for upc.boundAddr,
+// following the shape of golang.org/x/net/ipv4.PacketConn.ReadBatch: each
+// populated ms[i] has its payload copied into ms[i].Buffers[0], ms[i].N set
+// to its length, and ms[i].Addr set to the packet's source address. It
+// returns how many of ms were populated.
+//
+// udpMatch filtering against upc.boundAddr is applied per-message, same as
+// ReadFrom.
+func (upc *BroadcastRawUDPConn) ReadBatch(ms []xipv4.Message) (int, error) {
+	if len(ms) == 0 {
+		return 0, nil
+	}
+
+	frames := make([][]byte, len(ms))
+	bufs := make([]*[]byte, len(ms))
+	for i := range frames {
+		bufs[i] = framePool.Get().(*[]byte)
+		frames[i] = *bufs[i]
+	}
+	defer func() {
+		for i, buf := range bufs {
+			*buf = frames[i][:cap(frames[i])] // restore to full capacity before returning to the pool
+			framePool.Put(buf)
+		}
+	}()
+
+	var n int
+	var err error
+	if fb, ok := upc.conn.(frameBatcher); ok {
+		n, err = fb.ReadFrameBatch(frames)
+	} else {
+		n, err = readFrameBatchFallback(upc.conn, frames)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	out := 0
+	for i := 0; i < n; i++ {
+		payload, srcAddr, ok := parseUDPFrame(frames[i], upc.boundAddr)
+		if !ok {
+			continue
+		}
+		ms[out].N = copy(ms[out].Buffers[0], payload)
+		ms[out].Addr = srcAddr
+		out++
+	}
+	return out, nil
+}
+
+// readFrameBatchFallback reads into frames one at a time: it blocks for the
+// first frame, then sets a past-due read deadline so that no later read
+// blocks, rather than blocking until every slot is filled, which could stall
+// ReadBatch indefinitely on a generously sized batch.
+//
+// A conn whose deadlines go through Go's runtime poller (such as the TAP
+// backend's *os.File) fails every read once its deadline has passed, before
+// looking at frames already queued, so on such a conn the fallback returns
+// only the first frame.
+func readFrameBatchFallback(conn LinkConn, frames [][]byte) (int, error) {
+	n, err := conn.ReadFrame(frames[0])
+	if err != nil {
+		return 0, err
+	}
+	frames[0] = frames[0][:n]
+	if len(frames) == 1 {
+		return 1, nil
+	}
+
+	// Frames after the first must not block: with a past-due deadline
+	// ReadFrame returns at once instead of waiting, and the loop stops at
+	// its first error.
+	if err := conn.SetReadDeadline(time.Unix(0, 1)); err != nil {
+		return 1, nil
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	for i := 1; i < len(frames); i++ {
+		n, err := conn.ReadFrame(frames[i])
+		if err != nil {
+			return i, nil
+		}
+		frames[i] = frames[i][:n]
+	}
+	return len(frames), nil
+}
+
+// parseUDPFrame parses frame as an Ethernet+IPv4+UDP frame and returns its
+// UDP payload and source address, provided it matches bound. It is the
+// per-frame logic BroadcastRawUDPConn.ReadFrom and ReadBatch share.
+func parseUDPFrame(frame []byte, bound *net.UDPAddr) ([]byte, *net.UDPAddr, bool) {
+	buf := uio.NewBigEndianBuffer(frame)
+
+	if !buf.Has(ethernetHeaderSize) {
+		return nil, nil, false
+	}
+	eth := ethernetHeader(buf.Consume(ethernetHeaderSize))
+	if eth.etherType() != ethertypeIPv4 {
+		return nil, nil, false
+	}
+
+	if !buf.Has(ipv4MinimumSize) {
+		return nil, nil, false
+	}
+	ipHdr := ipv4(buf.Data())
+	if !buf.Has(int(ipHdr.headerLength())) {
+		return nil, nil, false
+	}
+	ipHdr = ipv4(buf.Consume(int(ipHdr.headerLength())))
+	if ipHdr.transportProtocol() != udpProtocolNumber {
+		return nil, nil, false
+	}
+
+	if !buf.Has(udpMinimumSize) {
+		return nil, nil, false
+	}
+	udpHdr := udp(buf.Consume(udpMinimumSize))
+
+	addr := &net.UDPAddr{IP: ipHdr.destinationAddress(), Port: int(udpHdr.destinationPort())}
+	if !udpMatch(addr, bound) {
+		return nil, nil, false
+	}
+	srcAddr := &net.UDPAddr{IP: ipHdr.sourceAddress(), Port: int(udpHdr.sourcePort())}
+
+	// Extra padding after end of IP packet should be ignored, same as
+	// ReadFrom.
+	dhcpLen := int(ipHdr.payloadLength()) - udpMinimumSize
+	return buf.Consume(dhcpLen), srcAddr, true
+}
+
+// dstMacFunc resolves the destination MAC a WriteBatch message should be
+// sent to; it mirrors the WriteTo logic of each of BroadcastRawUDPConn,
+// UnicastRawUDPConn, and AutoRawUDPConn.
+type dstMacFunc func(payload []byte, addr *net.UDPAddr) (net.HardwareAddr, error)
+
+// writeBatch writes up to len(ms) UDP packets, resolving each one's
+// destination MAC via dstMac, following the shape of
+// golang.org/x/net/ipv4.PacketConn.WriteBatch.
+func (upc *BroadcastRawUDPConn) writeBatch(ms []xipv4.Message, dstMac dstMacFunc) (int, error) {
+	if len(ms) == 0 {
+		return 0, nil
+	}
+
+	frames := make([][]byte, len(ms))
+	scratch := make([]*[]byte, len(ms))
+	defer func() {
+		for i, buf := range scratch {
+			if buf != nil {
+				*buf = frames[i][:cap(frames[i])] // restore to full capacity before returning to the pool
+				framePool.Put(buf)
+			}
+		}
+	}()
+
+	for i := range ms {
+		udpAddr, ok := ms[i].Addr.(*net.UDPAddr)
+		if !ok {
+			// Nothing has been sent yet at this point: the count returned
+			// must reflect packets actually written, per the
+			// ipv4.PacketConn.WriteBatch contract ReadBatch/WriteBatch
+			// mirror, not how far the prepare loop got.
+			return 0, ErrUDPAddrIsRequired
+		}
+		mac, err := dstMac(ms[i].Buffers[0], udpAddr)
+		if err != nil {
+			return 0, err
+		}
+
+		buf := framePool.Get().(*[]byte)
+		scratch[i] = buf
+		packet := udp4pkt(ms[i].Buffers[0], udpAddr, upc.boundAddr)
+		frames[i] = buildEthernetFrameInto(*buf, mac, upc.conn.LocalHardwareAddr(), ethertypeIPv4, packet)
+	}
+
+	if fb, ok := upc.conn.(frameBatcher); ok {
+		return fb.WriteFrameBatch(frames)
+	}
+	for i, frame := range frames {
+		if err := upc.conn.WriteFrame(frame); err != nil {
+			return i, err
+		}
+	}
+	return len(frames), nil
+}
+
+// WriteBatch implements a batched WriteTo for BroadcastRawUDPConn: every
+// message is broadcast, same as WriteTo.
+func (upc *BroadcastRawUDPConn) WriteBatch(ms []xipv4.Message) (int, error) {
+	return upc.writeBatch(ms, func([]byte, *net.UDPAddr) (net.HardwareAddr, error) {
+		return BroadcastMac, nil
+	})
+}
+
+// WriteBatch implements a batched WriteTo for UnicastRawUDPConn: every
+// message is unicast, same as WriteTo.
+func (upc *UnicastRawUDPConn) WriteBatch(ms []xipv4.Message) (int, error) {
+	return upc.writeBatch(ms, func(_ []byte, addr *net.UDPAddr) (net.HardwareAddr, error) {
+		mac, err := getHwAddr(addr.IP)
+		if err != nil {
+			return nil, ErrHWAddrNotFound
+		}
+		return mac, nil
+	})
+}
+
+// WriteBatch implements a batched WriteTo for AutoRawUDPConn: each message
+// is broadcast or unicast per-packet, same as WriteTo.
+func (upc *AutoRawUDPConn) WriteBatch(ms []xipv4.Message) (int, error) {
+	return upc.writeBatch(ms, func(payload []byte, addr *net.UDPAddr) (net.HardwareAddr, error) {
+		if !shouldBroadcast(payload) {
+			if mac, err := getHwAddr(addr.IP); err == nil {
+				return mac, nil
+			}
+		}
+		return BroadcastMac, nil
+	})
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && linux
+// +build go1.12,linux
+
+package nclient4
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// ReadFrameBatch implements frameBatcher using recvmmsg(2), so ReadBatch
+// can receive a whole burst of frames (e.g. a PXE boot storm) in one
+// syscall instead of one ReadFrame call each.
+func (c *rawLinkConn) ReadFrameBatch(bufs [][]byte) (int, error) {
+	rc, err := c.conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	hdrs := make([]unix.Mmsghdr, len(bufs))
+	iovs := make([]unix.Iovec, len(bufs))
+	for i, b := range bufs {
+		if len(b) == 0 {
+			continue
+		}
+		iovs[i].Base = &b[0]
+		iovs[i].SetLen(len(b))
+		hdrs[i].Hdr.Iov = &iovs[i]
+		hdrs[i].Hdr.SetIovlen(1)
+	}
+
+	var n int
+	var rerr error
+	if err := rc.Read(func(fd uintptr) bool {
+		n, rerr = unix.Recvmmsg(int(fd), hdrs, 0)
+		// EAGAIN means the fd isn't ready yet; EINTR means the syscall
+		// was interrupted by an unrelated signal. Both ask the runtime
+		// poller to wait and call us again, rather than surface as an
+		// error.
+		return rerr != unix.EAGAIN && rerr != unix.EINTR
+	}); err != nil {
+		return 0, err
+	}
+	if rerr != nil {
+		return 0, rerr
+	}
+
+	for i := 0; i < n; i++ {
+		bufs[i] = bufs[i][:hdrs[i].Len]
+	}
+	return n, nil
+}
+
+// WriteFrameBatch implements frameBatcher using sendmmsg(2), so WriteBatch
+// can send a whole batch of frames in one syscall instead of one
+// WriteFrame call each.
+func (c *rawLinkConn) WriteFrameBatch(frames [][]byte) (int, error) {
+	rc, err := c.conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	hdrs := make([]unix.Mmsghdr, len(frames))
+	iovs := make([]unix.Iovec, len(frames))
+	for i, f := range frames {
+		if len(f) == 0 {
+			continue
+		}
+		iovs[i].Base = &f[0]
+		iovs[i].SetLen(len(f))
+		hdrs[i].Hdr.Iov = &iovs[i]
+		hdrs[i].Hdr.SetIovlen(1)
+	}
+
+	var n int
+	var werr error
+	if err := rc.Write(func(fd uintptr) bool {
+		n, werr = unix.Sendmmsg(int(fd), hdrs, 0)
+		return werr != unix.EAGAIN && werr != unix.EINTR
+	}); err != nil {
+		return 0, err
+	}
+	return n, werr
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || linux || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd linux netbsd openbsd
+
+package nclient4
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	xipv4 "golang.org/x/net/ipv4"
+)
+
+// fakeBatchLinkConn is a LinkConn that neither reads nor writes a real
+// link, just enough to drive ReadBatch/WriteBatch's fallback paths: it
+// never implements frameBatcher, so ReadBatch/WriteBatch always go through
+// readFrameBatchFallback / the per-frame WriteFrame loop in writeBatch.
+type fakeBatchLinkConn struct {
+	local net.HardwareAddr
+
+	rx    [][]byte
+	rxErr error
+
+	tx [][]byte
+}
+
+func (c *fakeBatchLinkConn) ReadFrame(b []byte) (int, error) {
+	if len(c.rx) == 0 {
+		if c.rxErr != nil {
+			return 0, c.rxErr
+		}
+		return 0, errors.New("fakeBatchLinkConn: no more frames queued")
+	}
+	frame := c.rx[0]
+	c.rx = c.rx[1:]
+	return copy(b, frame), nil
+}
+
+func (c *fakeBatchLinkConn) WriteFrame(b []byte) error {
+	c.tx = append(c.tx, append([]byte(nil), b...))
+	return nil
+}
+
+func (c *fakeBatchLinkConn) LocalHardwareAddr() net.HardwareAddr { return c.local }
+func (c *fakeBatchLinkConn) SetReadDeadline(t time.Time) error   { return nil }
+func (c *fakeBatchLinkConn) SetWriteDeadline(t time.Time) error  { return nil }
+func (c *fakeBatchLinkConn) Close() error                        { return nil }
+
+// newTestFrame builds a frame carrying a UDP packet addressed to boundAddr
+// (the conn's own bound address) from srcAddr, the same shape ReadFrom
+// expects to parse incoming requests out of.
+func newTestFrame(t *testing.T, boundAddr, srcAddr *net.UDPAddr, payload []byte) []byte {
+	t.Helper()
+	packet := udp4pkt(payload, boundAddr, srcAddr)
+	return ethernetFrame(net.HardwareAddr{0xa, 0xa, 0xa, 0xa, 0xa, 0xa}, net.HardwareAddr{0xb, 0xb, 0xb, 0xb, 0xb, 0xb}, ethertypeIPv4, packet)
+}
+
+func TestReadBatchFallback(t *testing.T) {
+	boundAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 67}
+	srcAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 50), Port: 68}
+
+	lc := &fakeBatchLinkConn{
+		rx: [][]byte{
+			newTestFrame(t, boundAddr, srcAddr, []byte("hello")),
+			newTestFrame(t, boundAddr, srcAddr, []byte("world")),
+		},
+	}
+	upc := &BroadcastRawUDPConn{conn: lc, boundAddr: boundAddr}
+
+	ms := make([]xipv4.Message, 2)
+	for i := range ms {
+		ms[i].Buffers = [][]byte{make([]byte, 16)}
+	}
+
+	n, err := upc.ReadBatch(ms)
+	if err != nil {
+		t.Fatalf("ReadBatch: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("ReadBatch returned n = %d, want 2", n)
+	}
+	if got := string(ms[0].Buffers[0][:ms[0].N]); got != "hello" {
+		t.Errorf("ms[0] payload = %q, want %q", got, "hello")
+	}
+	if got := string(ms[1].Buffers[0][:ms[1].N]); got != "world" {
+		t.Errorf("ms[1] payload = %q, want %q", got, "world")
+	}
+}
+
+func TestReadBatchFallbackPartial(t *testing.T) {
+	boundAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 67}
+	srcAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 50), Port: 68}
+
+	// Only one frame is queued: a requested batch of 3 must return with
+	// just the one available, not block waiting for the other two.
+	lc := &fakeBatchLinkConn{
+		rx: [][]byte{newTestFrame(t, boundAddr, srcAddr, []byte("hello"))},
+	}
+	upc := &BroadcastRawUDPConn{conn: lc, boundAddr: boundAddr}
+
+	ms := make([]xipv4.Message, 3)
+	for i := range ms {
+		ms[i].Buffers = [][]byte{make([]byte, 16)}
+	}
+
+	n, err := upc.ReadBatch(ms)
+	if err != nil {
+		t.Fatalf("ReadBatch: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("ReadBatch returned n = %d, want 1", n)
+	}
+}
+
+func TestWriteBatchPrepareFailureSendsNothing(t *testing.T) {
+	boundAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 67}
+	lc := &fakeBatchLinkConn{local: net.HardwareAddr{0xc, 0xc, 0xc, 0xc, 0xc, 0xc}}
+	upc := &BroadcastRawUDPConn{conn: lc, boundAddr: boundAddr}
+
+	wantErr := errors.New("no route")
+	calls := 0
+	dstMac := func(payload []byte, addr *net.UDPAddr) (net.HardwareAddr, error) {
+		calls++
+		if calls == 2 {
+			return nil, wantErr
+		}
+		return BroadcastMac, nil
+	}
+
+	ms := []xipv4.Message{
+		{Buffers: [][]byte{[]byte("one")}, Addr: &net.UDPAddr{IP: net.IPv4(192, 168, 1, 10), Port: 68}},
+		{Buffers: [][]byte{[]byte("two")}, Addr: &net.UDPAddr{IP: net.IPv4(192, 168, 1, 11), Port: 68}},
+	}
+
+	n, err := upc.writeBatch(ms, dstMac)
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("writeBatch err = %v, want %v", err, wantErr)
+	}
+	// The first message's frame was only built, never sent: the prepare
+	// loop must not report it as written before writeBatch gets to the
+	// send loop below it.
+	if n != 0 {
+		t.Errorf("writeBatch n = %d, want 0 (nothing was actually sent)", n)
+	}
+	if len(lc.tx) != 0 {
+		t.Errorf("writeBatch wrote %d frames to the link, want 0", len(lc.tx))
+	}
+}
+
+func TestWriteBatchSendsEachFrame(t *testing.T) {
+	boundAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 67}
+	lc := &fakeBatchLinkConn{local: net.HardwareAddr{0xc, 0xc, 0xc, 0xc, 0xc, 0xc}}
+	upc := &BroadcastRawUDPConn{conn: lc, boundAddr: boundAddr}
+
+	ms := []xipv4.Message{
+		{Buffers: [][]byte{[]byte("one")}, Addr: &net.UDPAddr{IP: net.IPv4(192, 168, 1, 10), Port: 68}},
+		{Buffers: [][]byte{[]byte("two")}, Addr: &net.UDPAddr{IP: net.IPv4(192, 168, 1, 11), Port: 68}},
+	}
+
+	n, err := upc.writeBatch(ms, func([]byte, *net.UDPAddr) (net.HardwareAddr, error) {
+		return BroadcastMac, nil
+	})
+	if err != nil {
+		t.Fatalf("writeBatch: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("writeBatch n = %d, want 2", n)
+	}
+	if len(lc.tx) != 2 {
+		t.Fatalf("writeBatch wrote %d frames, want 2", len(lc.tx))
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || linux || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd linux netbsd openbsd
+
+package nclient4
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/mdlayher/arp"
+	"github.com/vishvananda/netlink"
+)
+
+// LinkConn is the link-layer dependency BroadcastRawUDPConn and its
+// variants need: something that can send and receive whole Ethernet
+// frames. It exists so callers can plug in a backend other than a raw
+// AF_PACKET/BPF socket bound to a physical interface — e.g. a TAP device
+// fd, for a DHCP client/server running inside a userspace network stack.
+//
+// See conn_linux.go/conn_other.go for the raw-socket implementation and
+// conn_tap.go for the TAP-fd one.
+type LinkConn interface {
+	// ReadFrame reads one Ethernet frame into b, returning its length.
+	ReadFrame(b []byte) (int, error)
+
+	// WriteFrame writes b, a full Ethernet frame, onto the link.
+	WriteFrame(b []byte) error
+
+	// LocalHardwareAddr is the hardware address frames are sent from.
+	LocalHardwareAddr() net.HardwareAddr
+
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// UDPConnType indicates the type of the udp conn.
+type UDPConnType int
+
+const (
+	// UDPBroadcast specifies the type of udp conn as broadcast.
+	//
+	// All the packets will be broadcasted.
+	UDPBroadcast UDPConnType = 0
+
+	// UDPUnicast specifies the type of udp conn as unicast.
+	// All the packets will be sent to a unicast MAC address.
+	UDPUnicast UDPConnType = 1
+
+	// UDPAuto specifies the type of udp conn as automatic.
+	//
+	// Each outgoing packet is inspected and broadcast or unicast per
+	// RFC 2131: the client's BROADCAST flag and its yiaddr/ciaddr decide,
+	// rather than a server-wide static choice.
+	UDPAuto UDPConnType = 2
+)
+
+var (
+	// BroadcastMac is the broadcast MAC address.
+	//
+	// Any UDP packet sent to this address is broadcast on the subnet.
+	BroadcastMac = net.HardwareAddr([]byte{255, 255, 255, 255, 255, 255})
+)
+
+var (
+	// ErrUDPAddrIsRequired is an error used when a passed argument is not of type "*net.UDPAddr".
+	ErrUDPAddrIsRequired = errors.New("must supply UDPAddr")
+
+	// ErrHWAddrNotFound is an error used when getting MAC address failed.
+	ErrHWAddrNotFound = errors.New("hardware address not found")
+)
+
+// NewRawUDPConn returns a UDP connection bound to the interface and udp address
+// given based on a raw packet socket.
+//
+// The interface can be completely unconfigured.
+func NewRawUDPConn(iface string, addr *net.UDPAddr, typ UDPConnType) (net.PacketConn, error) {
+	ifc, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	lc, err := newRawLinkConn(ifc)
+	if err != nil {
+		return nil, err
+	}
+	return NewUDPConn(lc, addr, typ), nil
+}
+
+// NewUDPConn returns a UDP connection that sends and receives DHCP packets
+// as Ethernet frames over lc, bound to addr.
+//
+// This is the LinkConn-based counterpart to NewRawUDPConn, for callers that
+// bring their own link layer (e.g. a TAP device via NewTAPLinkConn) instead
+// of a physical interface.
+func NewUDPConn(lc LinkConn, addr *net.UDPAddr, typ UDPConnType) net.PacketConn {
+	switch typ {
+	case UDPUnicast:
+		return NewUnicastRawUDPConn(lc, addr)
+	case UDPAuto:
+		return NewAutoRawUDPConn(lc, addr)
+	default:
+		return NewBroadcastUDPConn(lc, addr)
+	}
+}
+
+// BroadcastRawUDPConn uses a link-layer conn to send UDP packets to the
+// broadcast MAC address.
+type BroadcastRawUDPConn struct {
+	// conn is the underlying link-layer conn.
+	conn LinkConn
+
+	// boundAddr is the address this RawUDPConn is "bound" to.
+	//
+	// Calls to ReadFrom will only return packets destined to this address.
+	boundAddr *net.UDPAddr
+}
+
+// NewBroadcastUDPConn returns a PacketConn that marshals and unmarshals UDP
+// packets, sending them to the broadcast MAC over conn.
+//
+// Calls to ReadFrom will only return packets destined to boundAddr.
+func NewBroadcastUDPConn(conn LinkConn, boundAddr *net.UDPAddr) net.PacketConn {
+	return &BroadcastRawUDPConn{
+		conn:      conn,
+		boundAddr: boundAddr,
+	}
+}
+
+func udpMatch(addr *net.UDPAddr, bound *net.UDPAddr) bool {
+	if bound == nil {
+		return true
+	}
+	if bound.IP != nil && !bound.IP.Equal(addr.IP) {
+		return false
+	}
+	return bound.Port == addr.Port
+}
+
+// ReadFrom implements net.PacketConn.ReadFrom.
+//
+// ReadFrom reads Ethernet frames carrying IPv4 UDP packets and will try to
+// match them against upc.boundAddr. Any matching packets are returned via
+// the given buffer.
+func (upc *BroadcastRawUDPConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	frameLen := ethernetHeaderSize + ipv4MaximumHeaderSize + udpMinimumSize + len(b)
+
+	for {
+		frame := make([]byte, frameLen)
+		n, err := upc.conn.ReadFrame(frame)
+		if err != nil {
+			return 0, nil, err
+		}
+		if n == 0 {
+			return 0, nil, io.EOF
+		}
+
+		payload, srcAddr, ok := parseUDPFrame(frame[:n], upc.boundAddr)
+		if !ok {
+			continue
+		}
+		return copy(b, payload), srcAddr, nil
+	}
+}
+
+// WriteTo implements net.PacketConn.WriteTo and broadcasts all packets at the
+// link layer.
+//
+// WriteTo wraps the given packet in the appropriate UDP, IP, and Ethernet
+// headers before sending it on the underlying conn.
+func (upc *BroadcastRawUDPConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return upc.writeTo(b, addr, BroadcastMac)
+}
+
+func (upc *BroadcastRawUDPConn) writeTo(b []byte, addr net.Addr, dstMac net.HardwareAddr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, ErrUDPAddrIsRequired
+	}
+
+	// Using the boundAddr is not quite right here, but it works.
+	packet := udp4pkt(b, udpAddr, upc.boundAddr)
+	frame := ethernetFrame(dstMac, upc.conn.LocalHardwareAddr(), ethertypeIPv4, packet)
+	if err := upc.conn.WriteFrame(frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close implements net.PacketConn.Close.
+func (upc *BroadcastRawUDPConn) Close() error {
+	return upc.conn.Close()
+}
+
+// LocalAddr implements net.PacketConn.LocalAddr.
+func (upc *BroadcastRawUDPConn) LocalAddr() net.Addr {
+	return upc.boundAddr
+}
+
+// SetDeadline implements net.PacketConn.SetDeadline.
+func (upc *BroadcastRawUDPConn) SetDeadline(t time.Time) error {
+	if err := upc.conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return upc.conn.SetWriteDeadline(t)
+}
+
+// SetReadDeadline implements net.PacketConn.SetReadDeadline.
+func (upc *BroadcastRawUDPConn) SetReadDeadline(t time.Time) error {
+	return upc.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements net.PacketConn.SetWriteDeadline.
+func (upc *BroadcastRawUDPConn) SetWriteDeadline(t time.Time) error {
+	return upc.conn.SetWriteDeadline(t)
+}
+
+// UnicastRawUDPConn inherits from BroadcastRawUDPConn and override the WriteTo method
+type UnicastRawUDPConn struct {
+	*BroadcastRawUDPConn
+}
+
+// NewUnicastRawUDPConn returns a PacketConn which sending the packets to a unicast MAC address.
+func NewUnicastRawUDPConn(conn LinkConn, boundAddr *net.UDPAddr) net.PacketConn {
+	return &UnicastRawUDPConn{
+		BroadcastRawUDPConn: NewBroadcastUDPConn(conn, boundAddr).(*BroadcastRawUDPConn),
+	}
+}
+
+// WriteTo implements net.PacketConn.WriteTo.
+//
+// WriteTo try to get the MAC address of destination IP address before
+// unicast all packets at the link layer.
+func (upc *UnicastRawUDPConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, ErrUDPAddrIsRequired
+	}
+	dstMac, err := getHwAddr(udpAddr.IP)
+	if err != nil {
+		return 0, ErrHWAddrNotFound
+	}
+	return upc.writeTo(b, addr, dstMac)
+}
+
+// AutoRawUDPConn inherits from BroadcastRawUDPConn and picks broadcast or
+// unicast on a per-packet basis.
+type AutoRawUDPConn struct {
+	*BroadcastRawUDPConn
+}
+
+// NewAutoRawUDPConn returns a PacketConn which chooses, for every packet
+// written to it, whether to broadcast or unicast based on the DHCP payload
+// being sent.
+func NewAutoRawUDPConn(conn LinkConn, boundAddr *net.UDPAddr) net.PacketConn {
+	return &AutoRawUDPConn{
+		BroadcastRawUDPConn: NewBroadcastUDPConn(conn, boundAddr).(*BroadcastRawUDPConn),
+	}
+}
+
+// WriteTo implements net.PacketConn.WriteTo.
+//
+// WriteTo inspects the outgoing DHCP payload per RFC 2131: if the client set
+// the BROADCAST flag, or has no ciaddr yet (a yiaddr alone does not count,
+// see shouldBroadcast), the reply is broadcast; otherwise it is unicast to
+// the resolved hardware address of addr.
+func (upc *AutoRawUDPConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, ErrUDPAddrIsRequired
+	}
+
+	if !shouldBroadcast(b) {
+		if dstMac, err := getHwAddr(udpAddr.IP); err == nil {
+			return upc.writeTo(b, addr, dstMac)
+		}
+		// Fall through to broadcast: the client may not be ARP-reachable
+		// yet even though it claims an address of its own.
+	}
+
+	return upc.writeTo(b, addr, BroadcastMac)
+}
+
+// shouldBroadcast parses b as a DHCPv4 message and reports whether it
+// should be broadcast, per RFC 2131 Section 4.1, rather than unicast to
+// addr.
+//
+// The broadcast flag always wins. Past that, the direction of b matters:
+// yiaddr is only meaningful on a BOOTREPLY (a server offering or confirming
+// an address), and even there it isn't safe to unicast to — the client
+// doesn't own it yet, so ARP-resolving it can never succeed. ciaddr, by
+// contrast, is an address the client is already using, so it's always safe
+// to unicast to once set. A BOOTREQUEST never has a meaningful yiaddr at
+// all, so ciaddr is the only signal on that side.
+//
+// Malformed payloads fall back to broadcast, since that is always a safe
+// delivery choice.
+func shouldBroadcast(b []byte) bool {
+	msg, err := dhcpv4.FromBytes(b)
+	if err != nil {
+		return true
+	}
+	if msg.IsBroadcast() {
+		return true
+	}
+	if msg.OpCode == dhcpv4.OpcodeBootReply {
+		return msg.ClientIPAddr.IsUnspecified()
+	}
+	return msg.ClientIPAddr.IsUnspecified()
+}
+
+// getHwAddr from local arp cache. If no existing, try to get it by arp protocol.
+func getHwAddr(ip net.IP) (net.HardwareAddr, error) {
+	neighList, err := netlink.NeighListExecute(netlink.Ndmsg{
+		Family: netlink.FAMILY_V4,
+		State:  netlink.NUD_REACHABLE,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, neigh := range neighList {
+		if ip.Equal(neigh.IP) && neigh.HardwareAddr != nil {
+			return neigh.HardwareAddr, nil
+		}
+	}
+
+	return arpResolve(ip)
+}
+
+// arpResolveTimeout bounds how long arpResolve waits for a reply: dest not
+// answering ARP (e.g. it's offline, or behind a bug that requested unicast
+// to an address it doesn't actually own) must not hang the caller forever.
+const arpResolveTimeout = 2 * time.Second
+
+func arpResolve(dest net.IP) (net.HardwareAddr, error) {
+	// auto match the interface based on routes
+	routes, err := netlink.RouteGet(dest)
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("no route to %s found", dest.String())
+	}
+	ifc, err := net.InterfaceByIndex(routes[0].LinkIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := arp.Dial(ifc)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	if err := c.SetDeadline(time.Now().Add(arpResolveTimeout)); err != nil {
+		return nil, err
+	}
+	return c.Resolve(dest)
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && linux
+// +build go1.12,linux
+
+package nclient4
+
+import (
+	"net"
+	"time"
+
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/packet"
+)
+
+// rawLinkConn implements LinkConn over a raw AF_PACKET socket, in Raw mode
+// so ReadFrame/WriteFrame see and build the whole Ethernet frame.
+//
+// mdlayher/packet is Linux-only and replaces the deprecated mdlayher/raw for
+// this platform; see conn_other.go for the BSD/Darwin fallback.
+type rawLinkConn struct {
+	conn  *packet.Conn
+	local net.HardwareAddr
+}
+
+// newRawLinkConn opens a raw AF_PACKET socket on ifc filtering on
+// EtherTypeIPv4.
+func newRawLinkConn(ifc *net.Interface) (LinkConn, error) {
+	conn, err := packet.Listen(ifc, packet.Raw, int(ethernet.EtherTypeIPv4), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &rawLinkConn{conn: conn, local: ifc.HardwareAddr}, nil
+}
+
+func (c *rawLinkConn) ReadFrame(b []byte) (int, error) {
+	n, _, err := c.conn.ReadFrom(b)
+	return n, err
+}
+
+func (c *rawLinkConn) WriteFrame(b []byte) error {
+	_, err := c.conn.WriteTo(b, &packet.Addr{HardwareAddr: ethernetHeader(b).destination()})
+	return err
+}
+
+func (c *rawLinkConn) LocalHardwareAddr() net.HardwareAddr {
+	return c.local
+}
+
+func (c *rawLinkConn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *rawLinkConn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+func (c *rawLinkConn) Close() error                       { return c.conn.Close() }
@@ -0,0 +1,55 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd netbsd openbsd
+
+package nclient4
+
+import (
+	"net"
+	"time"
+
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/raw"
+)
+
+// rawLinkConn implements LinkConn over a raw BPF socket, with
+// LinuxSockDGRAM left false so ReadFrame/WriteFrame see and build the whole
+// Ethernet frame.
+//
+// mdlayher/packet only supports Linux's AF_PACKET, so these platforms keep
+// using the deprecated mdlayher/raw as a fallback.
+type rawLinkConn struct {
+	conn  *raw.Conn
+	local net.HardwareAddr
+}
+
+// newRawLinkConn opens a raw BPF socket on ifc filtering on EtherTypeIPv4.
+func newRawLinkConn(ifc *net.Interface) (LinkConn, error) {
+	conn, err := raw.ListenPacket(ifc, uint16(ethernet.EtherTypeIPv4), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &rawLinkConn{conn: conn, local: ifc.HardwareAddr}, nil
+}
+
+func (c *rawLinkConn) ReadFrame(b []byte) (int, error) {
+	n, _, err := c.conn.ReadFrom(b)
+	return n, err
+}
+
+func (c *rawLinkConn) WriteFrame(b []byte) error {
+	_, err := c.conn.WriteTo(b, &raw.Addr{HardwareAddr: ethernetHeader(b).destination()})
+	return err
+}
+
+func (c *rawLinkConn) LocalHardwareAddr() net.HardwareAddr {
+	return c.local
+}
+
+func (c *rawLinkConn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *rawLinkConn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+func (c *rawLinkConn) Close() error                       { return c.conn.Close() }
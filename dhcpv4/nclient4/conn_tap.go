@@ -0,0 +1,71 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && linux
+// +build go1.12,linux
+
+package nclient4
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// tapLinkConn implements LinkConn over a TAP device file descriptor, for
+// callers running DHCP inside a userspace network stack rather than owning
+// a physical interface.
+type tapLinkConn struct {
+	f     *os.File
+	local net.HardwareAddr
+}
+
+// NewTAPLinkConn opens (and, if needed, creates) the TAP device named
+// name and returns a LinkConn that reads and writes whole Ethernet frames
+// on it.
+func NewTAPLinkConn(name string) (LinkConn, error) {
+	f, err := os.OpenFile("/dev/net/tun", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening /dev/net/tun: %w", err)
+	}
+
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ifr.SetUint16(unix.IFF_TAP | unix.IFF_NO_PI)
+	if err := unix.IoctlIfreq(int(f.Fd()), unix.TUNSETIFF, ifr); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("TUNSETIFF %s: %w", name, err)
+	}
+
+	ifc, err := net.InterfaceByName(name)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &tapLinkConn{f: f, local: ifc.HardwareAddr}, nil
+}
+
+func (c *tapLinkConn) ReadFrame(b []byte) (int, error) {
+	return c.f.Read(b)
+}
+
+func (c *tapLinkConn) WriteFrame(b []byte) error {
+	_, err := c.f.Write(b)
+	return err
+}
+
+func (c *tapLinkConn) LocalHardwareAddr() net.HardwareAddr {
+	return c.local
+}
+
+func (c *tapLinkConn) SetReadDeadline(t time.Time) error  { return c.f.SetReadDeadline(t) }
+func (c *tapLinkConn) SetWriteDeadline(t time.Time) error { return c.f.SetWriteDeadline(t) }
+func (c *tapLinkConn) Close() error                       { return c.f.Close() }
@@ -0,0 +1,87 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || linux || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd linux netbsd openbsd
+
+package nclient4
+
+import (
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+func TestShouldBroadcast(t *testing.T) {
+	newMsg := func(mt dhcpv4.MessageType, opts ...func(*dhcpv4.DHCPv4)) []byte {
+		m, err := dhcpv4.NewDiscovery(net.HardwareAddr{1, 2, 3, 4, 5, 6})
+		if err != nil {
+			t.Fatalf("NewDiscovery: %v", err)
+		}
+		m.UpdateOption(dhcpv4.OptMessageType(mt))
+		for _, opt := range opts {
+			opt(m)
+		}
+		return m.ToBytes()
+	}
+
+	broadcastFlag := func(m *dhcpv4.DHCPv4) { m.SetBroadcast() }
+	asReply := func(m *dhcpv4.DHCPv4) { m.OpCode = dhcpv4.OpcodeBootReply }
+	withYiaddr := func(ip net.IP) func(*dhcpv4.DHCPv4) {
+		return func(m *dhcpv4.DHCPv4) { m.YourIPAddr = ip }
+	}
+	withCiaddr := func(ip net.IP) func(*dhcpv4.DHCPv4) {
+		return func(m *dhcpv4.DHCPv4) { m.ClientIPAddr = ip }
+	}
+
+	for _, tt := range []struct {
+		name string
+		pkt  []byte
+		want bool
+	}{
+		{
+			name: "discover with no addresses broadcasts",
+			pkt:  newMsg(dhcpv4.MessageTypeDiscover),
+			want: true,
+		},
+		{
+			name: "request with broadcast flag set broadcasts",
+			pkt:  newMsg(dhcpv4.MessageTypeRequest, broadcastFlag),
+			want: true,
+		},
+		{
+			name: "offer reply with only a yiaddr still broadcasts: the client doesn't own it yet",
+			pkt:  newMsg(dhcpv4.MessageTypeOffer, asReply, withYiaddr(net.IPv4(192, 168, 1, 5))),
+			want: true,
+		},
+		{
+			name: "ack reply with a ciaddr unicasts: the client is already using that address",
+			pkt:  newMsg(dhcpv4.MessageTypeAck, asReply, withCiaddr(net.IPv4(192, 168, 1, 5))),
+			want: false,
+		},
+		{
+			name: "ack reply with both yiaddr and ciaddr unicasts to ciaddr",
+			pkt:  newMsg(dhcpv4.MessageTypeAck, asReply, withYiaddr(net.IPv4(192, 168, 1, 5)), withCiaddr(net.IPv4(192, 168, 1, 5))),
+			want: false,
+		},
+		{
+			name: "ack reply with broadcast flag and a ciaddr still broadcasts",
+			pkt:  newMsg(dhcpv4.MessageTypeAck, asReply, broadcastFlag, withCiaddr(net.IPv4(192, 168, 1, 5))),
+			want: true,
+		},
+		{
+			name: "malformed payload falls back to broadcast",
+			pkt:  []byte{0x01, 0x02, 0x03},
+			want: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldBroadcast(tt.pkt); got != tt.want {
+				t.Errorf("shouldBroadcast() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || linux || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd linux netbsd openbsd
+
+package nclient4
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+const (
+	ethernetHeaderSize = 14
+	ethertypeIPv4      = 0x0800
+)
+
+// ethernetHeader is a 14-byte Ethernet II header, addressed the same way
+// the ipv4/udp helper types are: a byte slice with field accessors.
+//
+// Both LinkConn backends (raw socket and TAP) hand BroadcastRawUDPConn full
+// frames, so this header is built and parsed here once rather than per
+// backend.
+type ethernetHeader []byte
+
+func (h ethernetHeader) destination() net.HardwareAddr { return net.HardwareAddr(h[0:6]) }
+func (h ethernetHeader) source() net.HardwareAddr      { return net.HardwareAddr(h[6:12]) }
+func (h ethernetHeader) etherType() uint16             { return binary.BigEndian.Uint16(h[12:14]) }
+
+// ethernetFrame builds a single Ethernet II frame carrying payload, from
+// src to dst.
+func ethernetFrame(dst, src net.HardwareAddr, etherType uint16, payload []byte) []byte {
+	return buildEthernetFrameInto(make([]byte, 0, ethernetHeaderSize+len(payload)), dst, src, etherType, payload)
+}
+
+// buildEthernetFrameInto is ethernetFrame but reuses buf's storage instead
+// of allocating, for callers (like WriteBatch) building many frames out of
+// a scratch-buffer pool.
+func buildEthernetFrameInto(buf []byte, dst, src net.HardwareAddr, etherType uint16, payload []byte) []byte {
+	frame := buf[:0]
+	if cap(frame) < ethernetHeaderSize+len(payload) {
+		frame = make([]byte, 0, ethernetHeaderSize+len(payload))
+	}
+	frame = frame[:ethernetHeaderSize+len(payload)]
+
+	copy(frame[0:6], dst)
+	copy(frame[6:12], src)
+	binary.BigEndian.PutUint16(frame[12:14], etherType)
+	copy(frame[ethernetHeaderSize:], payload)
+	return frame
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || linux || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd linux netbsd openbsd
+
+package nserver4
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrNoLease is returned by LeaseStore.Renew when hwaddr holds no lease to
+// renew.
+var ErrNoLease = errors.New("nserver4: no lease held for this client")
+
+// Lease is a single allocated IPv4 lease, with RFC 2132-style lease-time
+// bookkeeping.
+type Lease struct {
+	ClientHWAddr net.HardwareAddr
+	IP           net.IP
+	Expires      time.Time
+}
+
+// Expired reports whether the lease is no longer valid at now.
+func (l *Lease) Expired(now time.Time) bool {
+	return now.After(l.Expires)
+}
+
+// LeaseStore is the pluggable lease bookkeeping a Handler allocates, renews,
+// and releases leases through, so that callers can bring their own
+// allocation policy and storage backend (e.g. harvester's own IPAM) rather
+// than depend on a specific one.
+type LeaseStore interface {
+	// Allocate returns a lease for hwaddr valid until now+leaseTime,
+	// reusing its existing lease if it still has one.
+	Allocate(hwaddr net.HardwareAddr, leaseTime time.Duration) (*Lease, error)
+
+	// Renew extends the existing lease for hwaddr until now+leaseTime. It
+	// returns ErrNoLease if hwaddr holds no lease.
+	Renew(hwaddr net.HardwareAddr, leaseTime time.Duration) (*Lease, error)
+
+	// Release frees the lease held by hwaddr, if any.
+	Release(hwaddr net.HardwareAddr) error
+
+	// Lookup returns the current, non-expired lease for hwaddr, if any.
+	Lookup(hwaddr net.HardwareAddr) (*Lease, bool)
+}
+
+// memoryLeaseStore is an in-memory LeaseStore that allocates sequentially
+// out of a fixed pool. It is meant for tests and small deployments; it does
+// not persist leases across restarts.
+type memoryLeaseStore struct {
+	mu     sync.Mutex
+	pool   []net.IP
+	leases map[string]*Lease // keyed by hwaddr.String()
+}
+
+// NewMemoryLeaseStore returns a LeaseStore that allocates IPs out of pool in
+// order and keeps all state in memory.
+func NewMemoryLeaseStore(pool []net.IP) LeaseStore {
+	return &memoryLeaseStore{
+		pool:   pool,
+		leases: make(map[string]*Lease),
+	}
+}
+
+func (s *memoryLeaseStore) Allocate(hwaddr net.HardwareAddr, leaseTime time.Duration) (*Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := hwaddr.String()
+	now := time.Now()
+	if l, ok := s.leases[key]; ok && !l.Expired(now) {
+		l.Expires = now.Add(leaseTime)
+		return l, nil
+	}
+
+	used := make(map[string]bool, len(s.leases))
+	for _, l := range s.leases {
+		used[l.IP.String()] = true
+	}
+	for _, ip := range s.pool {
+		if !used[ip.String()] {
+			l := &Lease{ClientHWAddr: hwaddr, IP: ip, Expires: now.Add(leaseTime)}
+			s.leases[key] = l
+			return l, nil
+		}
+	}
+	return nil, errors.New("nserver4: lease pool exhausted")
+}
+
+func (s *memoryLeaseStore) Renew(hwaddr net.HardwareAddr, leaseTime time.Duration) (*Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.leases[hwaddr.String()]
+	if !ok {
+		return nil, ErrNoLease
+	}
+	l.Expires = time.Now().Add(leaseTime)
+	return l, nil
+}
+
+func (s *memoryLeaseStore) Release(hwaddr net.HardwareAddr) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.leases, hwaddr.String())
+	return nil
+}
+
+func (s *memoryLeaseStore) Lookup(hwaddr net.HardwareAddr) (*Lease, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.leases[hwaddr.String()]
+	if !ok || l.Expired(time.Now()) {
+		return nil, false
+	}
+	return l, true
+}
@@ -0,0 +1,62 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || linux || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd linux netbsd openbsd
+
+package nserver4
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMemoryLeaseStore(t *testing.T) {
+	pool := []net.IP{net.IPv4(192, 168, 1, 10), net.IPv4(192, 168, 1, 11)}
+	store := NewMemoryLeaseStore(pool)
+
+	hw1 := net.HardwareAddr{1, 2, 3, 4, 5, 6}
+	hw2 := net.HardwareAddr{6, 5, 4, 3, 2, 1}
+
+	l1, err := store.Allocate(hw1, time.Hour)
+	if err != nil {
+		t.Fatalf("Allocate(hw1): %v", err)
+	}
+	if l1.IP.String() != "192.168.1.10" {
+		t.Errorf("Allocate(hw1).IP = %s, want 192.168.1.10", l1.IP)
+	}
+
+	l1Again, err := store.Allocate(hw1, time.Hour)
+	if err != nil {
+		t.Fatalf("re-Allocate(hw1): %v", err)
+	}
+	if !l1Again.IP.Equal(l1.IP) {
+		t.Errorf("re-Allocate(hw1).IP = %s, want %s", l1Again.IP, l1.IP)
+	}
+
+	l2, err := store.Allocate(hw2, time.Hour)
+	if err != nil {
+		t.Fatalf("Allocate(hw2): %v", err)
+	}
+	if l2.IP.Equal(l1.IP) {
+		t.Errorf("Allocate(hw2) reused hw1's IP %s", l2.IP)
+	}
+
+	if _, ok := store.Lookup(hw1); !ok {
+		t.Error("Lookup(hw1) = not found, want found")
+	}
+
+	if err := store.Release(hw1); err != nil {
+		t.Fatalf("Release(hw1): %v", err)
+	}
+	if _, ok := store.Lookup(hw1); ok {
+		t.Error("Lookup(hw1) after Release = found, want not found")
+	}
+
+	if _, err := store.Renew(hw1, time.Hour); err != ErrNoLease {
+		t.Errorf("Renew(hw1) after Release = %v, want ErrNoLease", err)
+	}
+}
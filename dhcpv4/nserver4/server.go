@@ -0,0 +1,134 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || linux || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd linux netbsd openbsd
+
+// Package nserver4 implements the server side of DHCPv4 on top of the same
+// raw-conn machinery nclient4 uses for the client side.
+package nserver4
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/nclient4"
+)
+
+// ErrHandlerRequired is returned by NewServer when no Handler is given.
+var ErrHandlerRequired = errors.New("nserver4: handler must not be nil")
+
+// Handler processes a single parsed DHCPv4 request and returns the reply to
+// send, if any. peer is the hardware address the request arrived from.
+//
+// A nil reply and nil error means the request (e.g. a DECLINE or RELEASE)
+// gets no reply, per RFC 2131.
+type Handler func(req *dhcpv4.DHCPv4, peer net.HardwareAddr) (*dhcpv4.DHCPv4, error)
+
+// Server listens for DHCPv4 requests on a raw conn and dispatches them to a
+// Handler.
+//
+// Replies are sent through the same BroadcastRawUDPConn/UnicastRawUDPConn
+// machinery nclient4 uses on the client side, via nclient4.UDPAuto: a reply
+// is broadcast or unicast per-packet based on the request's BROADCAST flag
+// and addresses, exactly as RFC 2131 describes.
+type Server struct {
+	conn    net.PacketConn
+	handler Handler
+
+	// ErrorLog, if non-nil, receives non-fatal per-request errors (a
+	// malformed packet, a Handler failure) instead of stopping Serve.
+	ErrorLog func(err error)
+}
+
+// NewServer returns a Server listening on iface for DHCPv4 requests.
+//
+// The returned Server is not yet serving; call Serve to start processing
+// packets.
+func NewServer(iface string, handler Handler) (*Server, error) {
+	if handler == nil {
+		return nil, ErrHandlerRequired
+	}
+	conn, err := nclient4.NewRawUDPConn(iface, &net.UDPAddr{Port: dhcpv4.ServerPort}, nclient4.UDPAuto)
+	if err != nil {
+		return nil, fmt.Errorf("nserver4: opening raw conn on %s: %w", iface, err)
+	}
+	return &Server{
+		conn:    conn,
+		handler: handler,
+	}, nil
+}
+
+// Close stops the Server from receiving further requests.
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+// Serve reads DHCPv4 requests off the raw conn until it is closed or
+// ReadFrom returns an error, dispatching each to the Handler.
+//
+// Serve blocks. Callers typically run it in its own goroutine and Close the
+// Server to stop it.
+func (s *Server) Serve() error {
+	buf := make([]byte, dhcpv4.MaxMessageSize)
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		req, err := dhcpv4.FromBytes(buf[:n])
+		if err != nil {
+			s.logError(fmt.Errorf("nserver4: skipping malformed request: %w", err))
+			continue
+		}
+		if req.OpCode != dhcpv4.OpcodeBootRequest {
+			continue
+		}
+
+		// The raw conn's ReadFrom only surfaces an IP-level source
+		// address, which a DISCOVER/REQUEST client usually doesn't have
+		// yet. The chaddr field is the one RFC 2131 guarantees is always
+		// populated, so it's what identifies the peer here.
+		peer := req.ClientHWAddr
+		reply, err := s.handler(req, peer)
+		if err != nil {
+			s.logError(fmt.Errorf("nserver4: handler error for %s: %w", peer, err))
+			continue
+		}
+		if reply == nil {
+			continue
+		}
+
+		dst := replyDestAddr(reply)
+		if _, err := s.conn.WriteTo(reply.ToBytes(), dst); err != nil {
+			s.logError(fmt.Errorf("nserver4: writing reply to %s: %w", dst, err))
+		}
+	}
+}
+
+func (s *Server) logError(err error) {
+	if s.ErrorLog != nil {
+		s.ErrorLog(err)
+	}
+}
+
+// replyDestAddr picks the UDP address a reply should be written to: the
+// client port, at whatever IP AutoRawUDPConn needs to pick broadcast vs.
+// unicast for (see nclient4.AutoRawUDPConn.WriteTo).
+//
+// ciaddr is preferred over yiaddr: a renewing client's reachable address is
+// ciaddr, and an INFORM reply has no yiaddr at all (it's 0.0.0.0), so using
+// yiaddr in either case would make AutoRawUDPConn fail to resolve the client
+// and fall back to broadcasting the reply.
+func replyDestAddr(reply *dhcpv4.DHCPv4) *net.UDPAddr {
+	ip := reply.YourIPAddr
+	if !reply.ClientIPAddr.IsUnspecified() {
+		ip = reply.ClientIPAddr
+	}
+	return &net.UDPAddr{IP: ip, Port: dhcpv4.ClientPort}
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || linux || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd linux netbsd openbsd
+
+package nserver4
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/nclient4"
+)
+
+func TestReplyDestAddr(t *testing.T) {
+	newReply := func(opts ...func(*dhcpv4.DHCPv4)) *dhcpv4.DHCPv4 {
+		m, err := dhcpv4.NewDiscovery(net.HardwareAddr{1, 2, 3, 4, 5, 6})
+		if err != nil {
+			t.Fatalf("NewDiscovery: %v", err)
+		}
+		for _, opt := range opts {
+			opt(m)
+		}
+		return m
+	}
+
+	withYiaddr := func(ip net.IP) func(*dhcpv4.DHCPv4) {
+		return func(m *dhcpv4.DHCPv4) { m.YourIPAddr = ip }
+	}
+	withCiaddr := func(ip net.IP) func(*dhcpv4.DHCPv4) {
+		return func(m *dhcpv4.DHCPv4) { m.ClientIPAddr = ip }
+	}
+
+	for _, tt := range []struct {
+		name  string
+		reply *dhcpv4.DHCPv4
+		want  string
+	}{
+		{
+			name:  "offer addresses the yiaddr being offered",
+			reply: newReply(withYiaddr(net.IPv4(192, 168, 1, 10))),
+			want:  "192.168.1.10",
+		},
+		{
+			name:  "ack to an inform has no yiaddr, falls back to ciaddr",
+			reply: newReply(withCiaddr(net.IPv4(192, 168, 1, 20))),
+			want:  "192.168.1.20",
+		},
+		{
+			name:  "ack to a renewal prefers ciaddr over a stale yiaddr",
+			reply: newReply(withYiaddr(net.IPv4(192, 168, 1, 10)), withCiaddr(net.IPv4(192, 168, 1, 20))),
+			want:  "192.168.1.20",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := replyDestAddr(tt.reply)
+			if dst.Port != dhcpv4.ClientPort {
+				t.Errorf("replyDestAddr().Port = %d, want %d", dst.Port, dhcpv4.ClientPort)
+			}
+			if dst.IP.String() != tt.want {
+				t.Errorf("replyDestAddr().IP = %s, want %s", dst.IP, tt.want)
+			}
+		})
+	}
+}
+
+// fakePacketConn is a net.PacketConn backed by in-memory channels, just
+// enough of the interface for Serve to dispatch a single request through a
+// Handler.
+type fakePacketConn struct {
+	net.PacketConn
+	reqs    chan []byte
+	written chan net.Addr
+	closed  chan struct{}
+}
+
+func (c *fakePacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case req, ok := <-c.reqs:
+		if !ok {
+			return 0, nil, net.ErrClosed
+		}
+		return copy(b, req), &net.UDPAddr{}, nil
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (c *fakePacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.written <- addr
+	return len(b), nil
+}
+
+func (c *fakePacketConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestServeDispatchesToHandler(t *testing.T) {
+	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{1, 2, 3, 4, 5, 6})
+	if err != nil {
+		t.Fatalf("NewDiscovery: %v", err)
+	}
+
+	conn := &fakePacketConn{
+		reqs:    make(chan []byte, 1),
+		written: make(chan net.Addr, 1),
+		closed:  make(chan struct{}),
+	}
+	conn.reqs <- req.ToBytes()
+
+	var gotPeer net.HardwareAddr
+	s := &Server{
+		conn: conn,
+		handler: func(req *dhcpv4.DHCPv4, peer net.HardwareAddr) (*dhcpv4.DHCPv4, error) {
+			gotPeer = peer
+			reply, err := dhcpv4.NewReplyFromRequest(req)
+			if err != nil {
+				t.Fatalf("NewReplyFromRequest: %v", err)
+			}
+			reply.YourIPAddr = net.IPv4(192, 168, 1, 10)
+			return reply, nil
+		},
+	}
+
+	go s.Serve()
+	defer s.Close()
+
+	dst := <-conn.written
+	if !bytes.Equal(gotPeer, req.ClientHWAddr) {
+		t.Errorf("handler called with peer = %s, want %s", gotPeer, req.ClientHWAddr)
+	}
+	want := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 10), Port: dhcpv4.ClientPort}
+	if dst.String() != want.String() {
+		t.Errorf("WriteTo addr = %s, want %s", dst, want)
+	}
+}
+
+// fakeLinkConn is a nclient4.LinkConn that records the frames WriteFrame is
+// given, rather than putting anything on a wire.
+type fakeLinkConn struct {
+	hwAddr net.HardwareAddr
+	frames [][]byte
+}
+
+func (c *fakeLinkConn) ReadFrame(b []byte) (int, error) { return 0, net.ErrClosed }
+
+func (c *fakeLinkConn) WriteFrame(b []byte) error {
+	c.frames = append(c.frames, append([]byte(nil), b...))
+	return nil
+}
+
+func (c *fakeLinkConn) LocalHardwareAddr() net.HardwareAddr { return c.hwAddr }
+func (c *fakeLinkConn) SetReadDeadline(t time.Time) error   { return nil }
+func (c *fakeLinkConn) SetWriteDeadline(t time.Time) error  { return nil }
+func (c *fakeLinkConn) Close() error                        { return nil }
+
+// TestServerOfferBroadcasts is a regression test for a server that ARP-
+// resolved a freshly offered (and thus not-yet-ARP-reachable) yiaddr
+// instead of broadcasting: an OFFER with a yiaddr but no ciaddr, written
+// through the same nclient4.UDPAuto conn NewServer uses, must go out
+// addressed to the Ethernet broadcast address, never attempt unicast.
+func TestServerOfferBroadcasts(t *testing.T) {
+	lc := &fakeLinkConn{hwAddr: net.HardwareAddr{0xa, 0xb, 0xc, 0xd, 0xe, 0xf}}
+	conn := nclient4.NewUDPConn(lc, &net.UDPAddr{Port: dhcpv4.ServerPort}, nclient4.UDPAuto)
+
+	reply, err := dhcpv4.NewReplyFromRequest(mustDiscover(t))
+	if err != nil {
+		t.Fatalf("NewReplyFromRequest: %v", err)
+	}
+	reply.OpCode = dhcpv4.OpcodeBootReply
+	reply.YourIPAddr = net.IPv4(192, 168, 1, 10)
+
+	if _, err := conn.WriteTo(reply.ToBytes(), replyDestAddr(reply)); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	if len(lc.frames) != 1 {
+		t.Fatalf("got %d frames written, want 1", len(lc.frames))
+	}
+	dstMac := net.HardwareAddr(lc.frames[0][:6])
+	if dstMac.String() != nclient4.BroadcastMac.String() {
+		t.Errorf("OFFER written to dst MAC %s, want broadcast %s", dstMac, nclient4.BroadcastMac)
+	}
+}
+
+func mustDiscover(t *testing.T) *dhcpv4.DHCPv4 {
+	t.Helper()
+	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{1, 2, 3, 4, 5, 6})
+	if err != nil {
+		t.Fatalf("NewDiscovery: %v", err)
+	}
+	return req
+}
@@ -0,0 +1,256 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || linux || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd linux netbsd openbsd
+
+// Package nclient6 is the IPv6 sibling of nclient4: it moves DHCPv6 packets
+// over a raw link-layer socket rather than a UDP one, for clients that run
+// before the interface has any IPv6 configuration of its own.
+package nclient6
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/u-root/uio/uio"
+	"github.com/vishvananda/netlink"
+)
+
+// rawConn is the raw-socket dependency nclient6 needs: a PacketConn on a
+// named interface that sends and receives IPv6 packets without their
+// Ethernet header, addressed by hardware address. See conn_linux.go
+// and conn_other.go for the per-platform implementations.
+type rawConn interface {
+	net.PacketConn
+}
+
+// UDPConnType indicates the type of the udp conn.
+type UDPConnType int
+
+const (
+	// UDPMulticast specifies the type of udp conn as multicast.
+	//
+	// All the packets will be sent to the DHCPv6 relay/server multicast
+	// group.
+	UDPMulticast UDPConnType = 0
+
+	// UDPUnicast specifies the type of udp conn as unicast.
+	// All the packets will be sent to a unicast MAC address.
+	UDPUnicast UDPConnType = 1
+)
+
+var (
+	// AllDHCPRelayAgentsAndServers is the DHCPv6 "All_DHCP_Relay_Agents_and_Servers"
+	// multicast group, ff02::1:2 (RFC 8415 Section 7.1).
+	AllDHCPRelayAgentsAndServers = net.ParseIP("ff02::1:2")
+
+	// MulticastMac is the Ethernet multicast address that
+	// AllDHCPRelayAgentsAndServers maps to, per RFC 2464 Section 7: 33:33
+	// followed by the low 32 bits of the IPv6 address.
+	MulticastMac = net.HardwareAddr([]byte{0x33, 0x33, 0x00, 0x01, 0x00, 0x02})
+)
+
+var (
+	// ErrUDPAddrIsRequired is an error used when a passed argument is not of type "*net.UDPAddr".
+	ErrUDPAddrIsRequired = errors.New("must supply UDPAddr")
+
+	// ErrHWAddrNotFound is an error used when getting MAC address failed.
+	ErrHWAddrNotFound = errors.New("hardware address not found")
+)
+
+// NewRawUDPConn6 returns a UDP connection bound to the interface and udp
+// address given based on a raw packet socket.
+//
+// The interface can be completely unconfigured.
+func NewRawUDPConn6(iface string, addr *net.UDPAddr, typ UDPConnType) (net.PacketConn, error) {
+	ifc, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := newRawConn6(ifc)
+	if err != nil {
+		return nil, err
+	}
+
+	if typ == UDPUnicast {
+		return NewUnicastRawUDPConn6(rc, addr), nil
+	}
+	return NewMulticastRawUDPConn6(rc, addr), nil
+}
+
+// MulticastRawUDPConn uses a raw socket to send UDP packets to the DHCPv6
+// relay/server multicast group.
+type MulticastRawUDPConn struct {
+	// PacketConn is a raw DGRAM socket.
+	net.PacketConn
+
+	// boundAddr is the address this conn is "bound" to.
+	//
+	// Calls to ReadFrom will only return packets destined to this address.
+	boundAddr *net.UDPAddr
+}
+
+// NewMulticastRawUDPConn6 returns a PacketConn that marshals and unmarshals
+// IPv6 UDP packets, sending them to the DHCPv6 multicast MAC on
+// rawPacketConn.
+//
+// Calls to ReadFrom will only return packets destined to boundAddr.
+func NewMulticastRawUDPConn6(rawPacketConn net.PacketConn, boundAddr *net.UDPAddr) net.PacketConn {
+	return &MulticastRawUDPConn{
+		PacketConn: rawPacketConn,
+		boundAddr:  boundAddr,
+	}
+}
+
+func udpMatch(addr *net.UDPAddr, bound *net.UDPAddr) bool {
+	if bound == nil {
+		return true
+	}
+	if bound.IP != nil && !bound.IP.Equal(addr.IP) {
+		return false
+	}
+	return bound.Port == addr.Port
+}
+
+// ReadFrom implements net.PacketConn.ReadFrom.
+//
+// ReadFrom reads raw IPv6 packets, skipping any extension headers, and will
+// try to match them against upc.boundAddr. Any matching packets are
+// returned via the given buffer.
+func (upc *MulticastRawUDPConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		pkt := make([]byte, ipv6HeaderSize+ipv6MaxExtHeaderSize+udpHeaderSize+len(b))
+		n, _, err := upc.PacketConn.ReadFrom(pkt)
+		if err != nil {
+			return 0, nil, err
+		}
+		if n == 0 {
+			return 0, nil, io.EOF
+		}
+		pkt = pkt[:n]
+		buf := uio.NewBigEndianBuffer(pkt)
+
+		if !buf.Has(ipv6HeaderSize) {
+			continue
+		}
+		ipHdr := ipv6(buf.Consume(ipv6HeaderSize))
+
+		nextHeader, payload, ok := skipExtensionHeaders(ipHdr.nextHeader(), buf)
+		if !ok || nextHeader != udpProtocolNumber {
+			continue
+		}
+
+		if !payload.Has(udpHeaderSize) {
+			continue
+		}
+		udpHdr := udp(payload.Consume(udpHeaderSize))
+
+		addr := &net.UDPAddr{
+			IP:   ipHdr.destinationAddress(),
+			Port: int(udpHdr.destinationPort()),
+		}
+		if !udpMatch(addr, upc.boundAddr) {
+			continue
+		}
+		srcAddr := &net.UDPAddr{
+			IP:   ipHdr.sourceAddress(),
+			Port: int(udpHdr.sourcePort()),
+		}
+		dhcpLen := int(udpHdr.length()) - udpHeaderSize
+		return copy(b, payload.Consume(dhcpLen)), srcAddr, nil
+	}
+}
+
+// WriteTo implements net.PacketConn.WriteTo and sends all packets to the
+// DHCPv6 relay/server multicast group at the raw socket level.
+//
+// WriteTo wraps the given packet in the appropriate UDP and IPv6 header
+// before sending it on the packet conn.
+func (upc *MulticastRawUDPConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, ErrUDPAddrIsRequired
+	}
+
+	packet := udp6pkt(b, udpAddr, upc.boundAddr)
+	return upc.PacketConn.WriteTo(packet, hwAddr6(MulticastMac))
+}
+
+// UnicastRawUDPConn6 inherits from MulticastRawUDPConn and overrides the
+// WriteTo method to unicast instead.
+type UnicastRawUDPConn6 struct {
+	*MulticastRawUDPConn
+}
+
+// NewUnicastRawUDPConn6 returns a PacketConn which sends packets to a
+// unicast MAC address resolved for the destination IPv6 address.
+func NewUnicastRawUDPConn6(rawPacketConn net.PacketConn, boundAddr *net.UDPAddr) net.PacketConn {
+	return &UnicastRawUDPConn6{
+		MulticastRawUDPConn: NewMulticastRawUDPConn6(rawPacketConn, boundAddr).(*MulticastRawUDPConn),
+	}
+}
+
+// WriteTo implements net.PacketConn.WriteTo.
+//
+// WriteTo tries to resolve the neighbor MAC address of the destination IPv6
+// address before unicasting the packet at the raw socket level.
+func (upc *UnicastRawUDPConn6) WriteTo(b []byte, addr net.Addr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, ErrUDPAddrIsRequired
+	}
+
+	packet := udp6pkt(b, udpAddr, upc.boundAddr)
+	dstMac, err := getHwAddr6(udpAddr.IP)
+	if err != nil {
+		return 0, ErrHWAddrNotFound
+	}
+
+	return upc.PacketConn.WriteTo(packet, hwAddr6(dstMac))
+}
+
+// getHwAddr6 looks up the neighbor MAC address for ip from the local IPv6
+// neighbor cache, falling back to ndpResolve.
+func getHwAddr6(ip net.IP) (net.HardwareAddr, error) {
+	neighList, err := netlink.NeighListExecute(netlink.Ndmsg{
+		Family: netlink.FAMILY_V6,
+		State:  netlink.NUD_REACHABLE,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, neigh := range neighList {
+		if ip.Equal(neigh.IP) && neigh.HardwareAddr != nil {
+			return neigh.HardwareAddr, nil
+		}
+	}
+
+	return ndpResolve(ip)
+}
+
+// ndpResolve triggers the kernel's own NDP neighbor solicitation for dest by
+// briefly dialing it, then reads the resulting entry back out of the
+// neighbor cache.
+func ndpResolve(dest net.IP) (net.HardwareAddr, error) {
+	conn, err := net.DialUDP("udp6", nil, &net.UDPAddr{IP: dest, Port: 1})
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+
+	neighList, err := netlink.NeighListExecute(netlink.Ndmsg{Family: netlink.FAMILY_V6})
+	if err != nil {
+		return nil, err
+	}
+	for _, neigh := range neighList {
+		if dest.Equal(neigh.IP) && neigh.HardwareAddr != nil {
+			return neigh.HardwareAddr, nil
+		}
+	}
+	return nil, ErrHWAddrNotFound
+}
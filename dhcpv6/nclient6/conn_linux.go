@@ -0,0 +1,25 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && linux
+// +build go1.12,linux
+
+package nclient6
+
+import (
+	"net"
+
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/packet"
+)
+
+// newRawConn6 opens a raw AF_PACKET socket on ifc filtering on EtherTypeIPv6.
+func newRawConn6(ifc *net.Interface) (rawConn, error) {
+	return packet.Listen(ifc, packet.Datagram, int(ethernet.EtherTypeIPv6), nil)
+}
+
+// hwAddr6 builds the link-layer address mdlayher/packet expects for WriteTo.
+func hwAddr6(hw net.HardwareAddr) net.Addr {
+	return &packet.Addr{HardwareAddr: hw}
+}
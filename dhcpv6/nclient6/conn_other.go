@@ -0,0 +1,86 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd netbsd openbsd
+
+package nclient6
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/raw"
+)
+
+// ethernetHeaderSize is the size of the Ethernet II header ethernetConn
+// strips from reads and prepends to writes.
+const ethernetHeaderSize = 14
+
+// newRawConn6 opens a raw BPF socket on ifc filtering on EtherTypeIPv6.
+//
+// Unlike AF_PACKET's SOCK_DGRAM mode on Linux (conn_linux.go), BSD BPF
+// devices always carry whole Ethernet frames, never bare IPv6 payloads —
+// raw.Config's LinuxSockDGRAM option is a Linux-only no-op here. ethernetConn
+// strips/builds that 14-byte header so conn.go's ReadFrom/WriteTo, which
+// assume a payload starting at the IPv6 header, see the same shape on
+// every platform.
+func newRawConn6(ifc *net.Interface) (rawConn, error) {
+	conn, err := raw.ListenPacket(ifc, uint16(ethernet.EtherTypeIPv6), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ethernetConn{Conn: conn, local: ifc.HardwareAddr}, nil
+}
+
+// hwAddr6 builds the link-layer address mdlayher/raw expects for WriteTo.
+func hwAddr6(hw net.HardwareAddr) net.Addr {
+	return &raw.Addr{HardwareAddr: hw}
+}
+
+// ethernetConn adapts a raw BPF net.PacketConn, which carries whole
+// Ethernet frames, to the bare-IPv6-payload shape MulticastRawUDPConn
+// expects — the shape AF_PACKET's SOCK_DGRAM mode already delivers on
+// Linux.
+type ethernetConn struct {
+	*raw.Conn
+	local net.HardwareAddr
+}
+
+// ReadFrom implements net.PacketConn.ReadFrom, stripping the Ethernet
+// header off the frame the BPF device hands back.
+func (c *ethernetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	frame := make([]byte, ethernetHeaderSize+len(b))
+	n, addr, err := c.Conn.ReadFrom(frame)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n < ethernetHeaderSize {
+		return 0, addr, nil
+	}
+	return copy(b, frame[ethernetHeaderSize:n]), addr, nil
+}
+
+// WriteTo implements net.PacketConn.WriteTo, wrapping b in an Ethernet
+// header addressed to addr before handing the whole frame to the BPF
+// device.
+func (c *ethernetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	ra, ok := addr.(*raw.Addr)
+	if !ok {
+		return 0, ErrUDPAddrIsRequired
+	}
+
+	frame := make([]byte, ethernetHeaderSize+len(b))
+	copy(frame[0:6], ra.HardwareAddr)
+	copy(frame[6:12], c.local)
+	binary.BigEndian.PutUint16(frame[12:14], uint16(ethernet.EtherTypeIPv6))
+	copy(frame[ethernetHeaderSize:], b)
+
+	if _, err := c.Conn.WriteTo(frame, addr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || linux || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd linux netbsd openbsd
+
+package nclient6
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/u-root/uio/uio"
+)
+
+const (
+	ipv6HeaderSize    = 40
+	udpHeaderSize     = 8
+	udpProtocolNumber = 17
+
+	// ipv6MaxExtHeaderSize is how much extra room ReadFrom reserves for
+	// extension headers between the fixed IPv6 header and the UDP header.
+	// DHCPv6 traffic has no legitimate reason to carry more than this.
+	ipv6MaxExtHeaderSize = 256
+)
+
+// IPv6 extension header "next header" values that precede the upper-layer
+// protocol and must be walked past to find it (RFC 8200 Section 4).
+const (
+	extHopByHop    = 0
+	extRouting     = 43
+	extFragment    = 44
+	extDestOptions = 60
+)
+
+// ipv6 is a 40-byte IPv6 fixed header, addressed the same way the original
+// ipv4 helper type is: a byte slice with field accessors.
+type ipv6 []byte
+
+func (h ipv6) nextHeader() byte           { return h[6] }
+func (h ipv6) sourceAddress() net.IP      { return net.IP(h[8:24]) }
+func (h ipv6) destinationAddress() net.IP { return net.IP(h[24:40]) }
+
+// udp is an 8-byte UDP header.
+type udp []byte
+
+func (u udp) sourcePort() uint16      { return binary.BigEndian.Uint16(u[0:2]) }
+func (u udp) destinationPort() uint16 { return binary.BigEndian.Uint16(u[2:4]) }
+func (u udp) length() uint16          { return binary.BigEndian.Uint16(u[4:6]) }
+
+// skipExtensionHeaders walks the IPv6 extension header chain starting at
+// nextHeader, consuming each one from buf, until it reaches an
+// upper-layer protocol or an extension header type it doesn't recognize.
+// Either way that next-header value is returned with ok=true; the caller
+// discards anything that isn't UDP.
+//
+// It tolerates malformed chains: running out of buffer ends the walk and
+// reports ok=false so the caller discards the packet rather than
+// misparsing it.
+func skipExtensionHeaders(nextHeader byte, buf *uio.Lexer) (byte, *uio.Lexer, bool) {
+	for {
+		switch nextHeader {
+		case extHopByHop, extRouting, extDestOptions:
+			if !buf.Has(2) {
+				return 0, nil, false
+			}
+			hdr := buf.Data()
+			extLen := (int(hdr[1]) + 1) * 8
+			if !buf.Has(extLen) {
+				return 0, nil, false
+			}
+			ext := buf.Consume(extLen)
+			nextHeader = ext[0]
+		case extFragment:
+			const fragHeaderSize = 8
+			if !buf.Has(fragHeaderSize) {
+				return 0, nil, false
+			}
+			ext := buf.Consume(fragHeaderSize)
+			nextHeader = ext[0]
+		default:
+			return nextHeader, buf, true
+		}
+	}
+}
+
+// udp6pkt wraps b in a UDP and IPv6 header addressed to dst, sourced from
+// src (the conn's bound address).
+func udp6pkt(b []byte, dst *net.UDPAddr, src *net.UDPAddr) []byte {
+	udpLen := udpHeaderSize + len(b)
+	pkt := make([]byte, ipv6HeaderSize+udpLen)
+
+	// IPv6 fixed header.
+	pkt[0] = 0x60 // version 6, traffic class and flow label left zero
+	binary.BigEndian.PutUint16(pkt[4:6], uint16(udpLen))
+	pkt[6] = udpProtocolNumber
+	pkt[7] = 64 // hop limit
+	copy(pkt[8:24], srcIP(src).To16())
+	copy(pkt[24:40], dst.IP.To16())
+
+	// UDP header; checksum is left zero, as the original IPv4 path does
+	// for its own header (the kernel/peer DHCP stack does not require it
+	// to be set over a raw link-layer socket).
+	udpHdr := pkt[ipv6HeaderSize:]
+	srcPort := uint16(0)
+	if src != nil {
+		srcPort = uint16(src.Port)
+	}
+	binary.BigEndian.PutUint16(udpHdr[0:2], srcPort)
+	binary.BigEndian.PutUint16(udpHdr[2:4], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udpHdr[4:6], uint16(udpLen))
+	copy(udpHdr[udpHeaderSize:], b)
+
+	return pkt
+}
+
+func srcIP(addr *net.UDPAddr) net.IP {
+	if addr == nil || addr.IP == nil {
+		return net.IPv6unspecified
+	}
+	return addr.IP
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 the u-root Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12 && (darwin || freebsd || linux || netbsd || openbsd)
+// +build go1.12
+// +build darwin freebsd linux netbsd openbsd
+
+package nclient6
+
+import (
+	"testing"
+
+	"github.com/u-root/uio/uio"
+)
+
+func TestSkipExtensionHeaders(t *testing.T) {
+	// A hop-by-hop options header (8 bytes: next header, hdr ext len = 0
+	// meaning 8 bytes total, then 6 bytes of options) followed directly
+	// by UDP.
+	hopByHop := []byte{udpProtocolNumber, 0, 0, 0, 0, 0, 0, 0}
+
+	for _, tt := range []struct {
+		name       string
+		nextHeader byte
+		buf        []byte
+		wantProto  byte
+		wantOK     bool
+	}{
+		{
+			name:       "no extension headers",
+			nextHeader: udpProtocolNumber,
+			buf:        nil,
+			wantProto:  udpProtocolNumber,
+			wantOK:     true,
+		},
+		{
+			name:       "single hop-by-hop header",
+			nextHeader: extHopByHop,
+			buf:        hopByHop,
+			wantProto:  udpProtocolNumber,
+			wantOK:     true,
+		},
+		{
+			name:       "truncated extension header",
+			nextHeader: extHopByHop,
+			buf:        []byte{udpProtocolNumber},
+			wantProto:  0,
+			wantOK:     false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			lex := uio.NewBigEndianBuffer(tt.buf)
+			proto, _, ok := skipExtensionHeaders(tt.nextHeader, lex)
+			if ok != tt.wantOK {
+				t.Fatalf("skipExtensionHeaders() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && proto != tt.wantProto {
+				t.Errorf("skipExtensionHeaders() proto = %d, want %d", proto, tt.wantProto)
+			}
+		})
+	}
+}
+
+func TestMulticastMac(t *testing.T) {
+	want := "33:33:00:01:00:02"
+	if got := MulticastMac.String(); got != want {
+		t.Errorf("MulticastMac.String() = %q, want %q", got, want)
+	}
+}